@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/crosbymichael/boss/config"
+	"github.com/crosbymichael/boss/monitor"
+	"github.com/urfave/cli"
+)
+
+var checkpointFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "leave-running",
+		Usage: "leave the task running after the checkpoint is taken",
+	},
+	cli.BoolFlag{
+		Name:  "tcp-established",
+		Usage: "checkpoint/restore established TCP connections",
+	},
+	cli.BoolFlag{
+		Name:  "keep",
+		Usage: "keep the checkpoint image in the content store",
+	},
+	cli.StringFlag{
+		Name:  "export",
+		Usage: "write the checkpoint tar to this path instead of <data root>/<id>/checkpoints (/var/lib/boss unless rootless)",
+	},
+}
+
+var checkpointCommand = cli.Command{
+	Name:  "checkpoint",
+	Usage: "checkpoint a running container to a tar archive",
+	Flags: checkpointFlags,
+	Action: func(clix *cli.Context) error {
+		ctx := namespaces.WithNamespace(context.Background(), clix.GlobalString("namespace"))
+		client, err := containerd.New(
+			config.SocketAddress(),
+			containerd.WithDefaultRuntime(config.DefaultShim()),
+		)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		m := monitor.New(client, nil, nil)
+		path, err := m.Checkpoint(ctx, clix.Args().First(), monitor.CheckpointOptions{
+			LeaveRunning:   clix.Bool("leave-running"),
+			TCPEstablished: clix.Bool("tcp-established"),
+			Keep:           clix.Bool("keep"),
+			Export:         clix.String("export"),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+var restoreCommand = cli.Command{
+	Name:      "restore",
+	Usage:     "restore a container from a checkpoint tar archive",
+	ArgsUsage: "<id> <checkpoint-path>",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "leave-running",
+			Usage: "start the restored task immediately",
+		},
+		cli.BoolFlag{
+			Name:  "tcp-established",
+			Usage: "restore established TCP connections",
+		},
+	},
+	Action: func(clix *cli.Context) error {
+		ctx := namespaces.WithNamespace(context.Background(), clix.GlobalString("namespace"))
+		client, err := containerd.New(
+			config.SocketAddress(),
+			containerd.WithDefaultRuntime(config.DefaultShim()),
+		)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		m := monitor.New(client, nil, nil)
+		return m.Restore(ctx, clix.Args().Get(0), clix.Args().Get(1), monitor.RestoreOptions{
+			LeaveRunning:   clix.Bool("leave-running"),
+			TCPEstablished: clix.Bool("tcp-established"),
+		})
+	},
+}
+
+var containerCommand = cli.Command{
+	Name:  "container",
+	Usage: "manage boss containers",
+	Subcommands: []cli.Command{
+		containerMigrateCommand,
+	},
+}
+
+var containerMigrateCommand = cli.Command{
+	Name:      "migrate",
+	Usage:     "checkpoint a container and restore it on a peer boss daemon",
+	ArgsUsage: "<id> <remote-addr>",
+	Action: func(clix *cli.Context) error {
+		ctx := namespaces.WithNamespace(context.Background(), clix.GlobalString("namespace"))
+		client, err := containerd.New(
+			config.SocketAddress(),
+			containerd.WithDefaultRuntime(config.DefaultShim()),
+		)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		m := monitor.New(client, nil, nil)
+		return m.Migrate(ctx, clix.Args().Get(0), clix.Args().Get(1))
+	},
+}
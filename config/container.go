@@ -29,9 +29,10 @@ func init() {
 type NetworkType string
 
 const (
-	Host NetworkType = "host"
-	CNI  NetworkType = "cni"
-	None NetworkType = ""
+	Host        NetworkType = "host"
+	CNI         NetworkType = "cni"
+	Slirp4netns NetworkType = "slirp4netns"
+	None        NetworkType = ""
 )
 
 type Container struct {
@@ -45,6 +46,16 @@ type Container struct {
 	Labels    []string           `toml:"labels"`
 	Network   NetworkType        `toml:"network"`
 	Services  map[string]Service `toml:"services"`
+	// Runtime selects the runtime class the container is created with, e.g.
+	// "runc", "kata", "runsc", or "rune" for SGX enclaves; defaults to runc
+	Runtime string `toml:"runtime"`
+	// RuntimeOptions are passed to the selected runtime's shim and mirrored
+	// onto the OCI spec as annotations for runtimes that key behavior off
+	// them, e.g. rune's enclave.type
+	RuntimeOptions map[string]string `toml:"runtime_options"`
+	// Rootless runs the container in a user namespace owned by the invoking
+	// unprivileged user; leave nil to run privileged
+	Rootless *Rootless `toml:"rootless"`
 }
 
 // WithBossConfig is a containerd.NewContainerOpts for spec and container configuration
@@ -58,6 +69,15 @@ func WithBossConfig(config *Container, image containerd.Image) containerd.NewCon
 		if err := containerd.WithContainerLabels(toStrings(config.Labels))(ctx, client, c); err != nil {
 			return err
 		}
+		// resolve the runtime class for the container
+		if err := config.withRuntime()(ctx, client, c); err != nil {
+			return err
+		}
+		if config.Rootless != nil {
+			if err := containerd.WithSnapshotter(RootlessSnapshotter)(ctx, client, c); err != nil {
+				return err
+			}
+		}
 		// save the config as a container extension
 		return containerd.WithContainerExtension(Extension, config)(ctx, client, c)
 	}
@@ -73,6 +93,9 @@ func (config *Container) specOpt(image containerd.Image) oci.SpecOpts {
 		oci.WithEnv(config.Env),
 		withMounts(config.Mounts),
 	}
+	if config.Rootless != nil {
+		opts = append(opts, withRootlessUserNamespace(config.Rootless))
+	}
 	if config.Network == Host {
 		opts = append(opts, oci.WithHostHostsFile, oci.WithHostResolvconf, oci.WithHostNamespace(specs.NetworkNamespace))
 	} else {
@@ -88,6 +111,7 @@ func (config *Container) specOpt(image containerd.Image) oci.SpecOpts {
 		),
 		)
 	}
+	opts = append(opts, withRuntimeAnnotations(config.RuntimeOptions))
 	return oci.Compose(opts...)
 }
 
@@ -109,6 +133,9 @@ type Check struct {
 	Type     CheckType `toml:"type"`
 	Interval int       `toml:"interval"`
 	Timeout  int       `toml:"timeout"`
+	// Retries is the number of consecutive failures before the check is
+	// considered unhealthy; defaults to 3 when unset
+	Retries int `toml:"retries"`
 }
 
 type Resources struct {
@@ -199,14 +226,15 @@ func withMounts(mounts []Mount) oci.SpecOpts {
 
 func withContainerHostsFile(ctx context.Context, _ oci.Client, c *containers.Container, s *oci.Spec) error {
 	id := c.ID
-	if err := os.MkdirAll(filepath.Join(Root, id), 0711); err != nil {
+	root := DataRoot()
+	if err := os.MkdirAll(filepath.Join(root, id), 0711); err != nil {
 		return err
 	}
 	hostname := s.Hostname
 	if hostname == "" {
 		hostname = id
 	}
-	path := filepath.Join(Root, id, "hosts")
+	path := filepath.Join(root, id, "hosts")
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -234,7 +262,7 @@ func withBossResolvconf(ctx context.Context, _ oci.Client, c *containers.Contain
 	s.Mounts = append(s.Mounts, specs.Mount{
 		Destination: "/etc/resolv.conf",
 		Type:        "bind",
-		Source:      filepath.Join(Root, "resolv.conf"),
+		Source:      filepath.Join(DataRoot(), "resolv.conf"),
 		Options:     []string{"rbind", "ro"},
 	})
 	return nil
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/defaults"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// RootlessSnapshotter is the containerd snapshotter rootless containers use
+// in place of the privileged overlay driver
+const RootlessSnapshotter = "fuse-overlayfs"
+
+// IDMap is a single uid/gid mapping entry for a user namespace
+type IDMap struct {
+	ContainerID int `toml:"container_id"`
+	HostID      int `toml:"host_id"`
+	Size        int `toml:"size"`
+}
+
+// Rootless configures a container to run inside a user namespace owned by
+// the invoking unprivileged user, mirroring podman's rootless mode. Leaving
+// the mapping fields empty derives them from /etc/subuid and /etc/subgid for
+// the invoking user, same as podman.
+type Rootless struct {
+	UIDMappings []IDMap `toml:"uid_mappings"`
+	GIDMappings []IDMap `toml:"gid_mappings"`
+}
+
+// EffectiveNetwork returns the network type the container should actually be
+// attached to: slirp4netns in place of CNI when running rootless, since
+// CNI's usual bridge/iptables setup needs privileges an unprivileged user
+// doesn't have.
+func (c *Container) EffectiveNetwork() NetworkType {
+	if c.Rootless != nil && c.Network == CNI {
+		return Slirp4netns
+	}
+	return c.Network
+}
+
+// IsRootless reports whether the boss process itself is running unprivileged
+func IsRootless() bool {
+	return os.Getuid() != 0
+}
+
+// DataRoot returns the directory boss keeps its per-container state under:
+// $XDG_DATA_HOME/boss (or ~/.local/share/boss) when running rootless,
+// otherwise the usual /var/lib/boss.
+func DataRoot() string {
+	if !IsRootless() {
+		return Root
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "boss")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share", "boss")
+}
+
+// SocketAddress returns the containerd socket boss should dial: the
+// system-wide socket when privileged, or the user-scoped socket under
+// $XDG_RUNTIME_DIR when rootless.
+func SocketAddress() string {
+	if !IsRootless() {
+		return defaults.DefaultAddress
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "containerd", "containerd.sock")
+	}
+	return filepath.Join("/run/user", strconv.Itoa(os.Getuid()), "containerd", "containerd.sock")
+}
+
+func withRootlessUserNamespace(r *Rootless) oci.SpecOpts {
+	return func(ctx context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		uidMappings := r.UIDMappings
+		gidMappings := r.GIDMappings
+		if len(uidMappings) == 0 {
+			m, err := subIDMappings("/etc/subuid", os.Getuid())
+			if err != nil {
+				return err
+			}
+			uidMappings = m
+		}
+		if len(gidMappings) == 0 {
+			m, err := subIDMappings("/etc/subgid", os.Getgid())
+			if err != nil {
+				return err
+			}
+			gidMappings = m
+		}
+		s.Linux.Namespaces = append(s.Linux.Namespaces, specs.LinuxNamespace{
+			Type: specs.UserNamespace,
+		})
+		s.Linux.UIDMappings = toSpecIDMappings(uidMappings)
+		s.Linux.GIDMappings = toSpecIDMappings(gidMappings)
+		return nil
+	}
+}
+
+func toSpecIDMappings(maps []IDMap) []specs.LinuxIDMapping {
+	out := make([]specs.LinuxIDMapping, 0, len(maps))
+	for _, m := range maps {
+		out = append(out, specs.LinuxIDMapping{
+			ContainerID: uint32(m.ContainerID),
+			HostID:      uint32(m.HostID),
+			Size:        uint32(m.Size),
+		})
+	}
+	return out
+}
+
+// subIDMappings reads the invoking user's range out of /etc/subuid or
+// /etc/subgid, formatted as "name:start:count" per line, and maps it in
+// starting at container id 1, with container id 0 mapped to ownerID (the
+// invoking user's own uid or gid). The invoking user is resolved via os/user
+// rather than $USER, since that's commonly unset when boss is run from a
+// systemd unit or cron.
+func subIDMappings(path string, ownerID int) ([]IDMap, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	return parseSubIDMappings(path, u.Username, ownerID)
+}
+
+// parseSubIDMappings does the actual file parsing for subIDMappings; split
+// out so it can be tested without depending on the real /etc/subuid and the
+// user running the test.
+func parseSubIDMappings(path, username string, uid int) ([]IDMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) != 3 || fields[0] != username {
+			continue
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		return []IDMap{
+			{ContainerID: 0, HostID: uid, Size: 1},
+			{ContainerID: 1, HostID: start, Size: count},
+		}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no entry for user %q in %s", username, path)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func writeSubIDFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "subuid")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestParseSubIDMappings(t *testing.T) {
+	path := writeSubIDFile(t, "someoneelse:200000:65536\nalice:100000:65536\n")
+
+	maps, err := parseSubIDMappings(path, "alice", 1000)
+	if err != nil {
+		t.Fatalf("parseSubIDMappings: %v", err)
+	}
+	want := []IDMap{
+		{ContainerID: 0, HostID: 1000, Size: 1},
+		{ContainerID: 1, HostID: 100000, Size: 65536},
+	}
+	if len(maps) != len(want) || maps[0] != want[0] || maps[1] != want[1] {
+		t.Fatalf("parseSubIDMappings: got %+v, want %+v", maps, want)
+	}
+}
+
+func TestParseSubIDMappingsNoEntry(t *testing.T) {
+	path := writeSubIDFile(t, "someoneelse:200000:65536\n")
+
+	if _, err := parseSubIDMappings(path, "alice", 1000); err == nil {
+		t.Fatal("expected an error when the user has no subuid entry, got nil")
+	}
+}
+
+func TestToSpecIDMappings(t *testing.T) {
+	in := []IDMap{
+		{ContainerID: 0, HostID: 1000, Size: 1},
+		{ContainerID: 1, HostID: 100000, Size: 65536},
+	}
+	out := toSpecIDMappings(in)
+	want := []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: 1000, Size: 1},
+		{ContainerID: 1, HostID: 100000, Size: 65536},
+	}
+	if len(out) != len(want) || out[0] != want[0] || out[1] != want[1] {
+		t.Fatalf("toSpecIDMappings: got %+v, want %+v", out, want)
+	}
+}
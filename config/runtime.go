@@ -0,0 +1,81 @@
+package config
+
+import (
+	"context"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/typeurl"
+)
+
+// supported runtime classes, selected via Container.Runtime
+const (
+	RuntimeRunc  = "runc"
+	RuntimeKata  = "kata"
+	RuntimeRunsc = "runsc"
+	RuntimeRune  = "rune"
+)
+
+// shims maps a runtime class to the containerd shim it resolves to
+var shims = map[string]string{
+	RuntimeRunc:  "io.containerd.runc.v1",
+	RuntimeKata:  "io.containerd.kata.v2",
+	RuntimeRunsc: "io.containerd.runsc.v1",
+	RuntimeRune:  "io.containerd.rune.v2",
+}
+
+func init() {
+	typeurl.Register(&RuntimeOptions{}, "io.boss.v1.RuntimeOptions")
+}
+
+// RuntimeOptions is marshaled as the containerd runtime options for the
+// container's task, carrying Container.RuntimeOptions through to the shim
+type RuntimeOptions struct {
+	Options map[string]string
+}
+
+// DefaultShim is the containerd runtime shim used when a container doesn't
+// select a Runtime class, and as the client-wide default for commands that
+// operate on containers whose own persisted runtime is resolved by
+// containerd itself (delete, checkpoint, restore, migrate, healthcheck).
+func DefaultShim() string {
+	return shims[RuntimeRunc]
+}
+
+// Shim returns the containerd runtime shim for the container's configured
+// Runtime class, defaulting to runc. An unrecognized Runtime is passed
+// through unchanged so operators can point at a shim directly.
+func (config *Container) Shim() string {
+	if config.Runtime == "" {
+		return DefaultShim()
+	}
+	if shim, ok := shims[config.Runtime]; ok {
+		return shim
+	}
+	return config.Runtime
+}
+
+// withRuntime resolves the container's runtime class to a containerd
+// NewContainerOpts that sets the shim and marshals any runtime options
+func (config *Container) withRuntime() containerd.NewContainerOpts {
+	return containerd.WithRuntime(config.Shim(), &RuntimeOptions{Options: config.RuntimeOptions})
+}
+
+// withRuntimeAnnotations mirrors RuntimeOptions onto the OCI spec so
+// runtimes that key behavior off annotations (e.g. rune's enclave.type and
+// entrypoint for SGX enclaves) can see them
+func withRuntimeAnnotations(options map[string]string) oci.SpecOpts {
+	return func(ctx context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if len(options) == 0 {
+			return nil
+		}
+		if s.Annotations == nil {
+			s.Annotations = make(map[string]string, len(options))
+		}
+		for k, v := range options {
+			s.Annotations[k] = v
+		}
+		return nil
+	}
+}
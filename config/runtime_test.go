@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestContainerShim(t *testing.T) {
+	cases := []struct {
+		runtime string
+		want    string
+	}{
+		{"", shims[RuntimeRunc]},
+		{RuntimeRunc, shims[RuntimeRunc]},
+		{RuntimeKata, shims[RuntimeKata]},
+		{RuntimeRunsc, shims[RuntimeRunsc]},
+		{RuntimeRune, shims[RuntimeRune]},
+		{"io.containerd.custom.v1", "io.containerd.custom.v1"},
+	}
+	for _, c := range cases {
+		container := &Container{Runtime: c.runtime}
+		if got := container.Shim(); got != c.want {
+			t.Errorf("Shim() for runtime %q: got %q, want %q", c.runtime, got, c.want)
+		}
+	}
+}
+
+func TestDefaultShim(t *testing.T) {
+	if got, want := DefaultShim(), shims[RuntimeRunc]; got != want {
+		t.Errorf("DefaultShim(): got %q, want %q", got, want)
+	}
+}
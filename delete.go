@@ -4,8 +4,8 @@ import (
 	"context"
 
 	"github.com/containerd/containerd"
-	"github.com/containerd/containerd/defaults"
 	"github.com/containerd/containerd/namespaces"
+	"github.com/crosbymichael/boss/config"
 	"github.com/crosbymichael/boss/monitor"
 	"github.com/urfave/cli"
 )
@@ -16,8 +16,8 @@ var deleteCommand = cli.Command{
 	Action: func(clix *cli.Context) error {
 		ctx := namespaces.WithNamespace(context.Background(), clix.GlobalString("namespace"))
 		client, err := containerd.New(
-			defaults.DefaultAddress,
-			containerd.WithDefaultRuntime("io.containerd.runc.v1"),
+			config.SocketAddress(),
+			containerd.WithDefaultRuntime(config.DefaultShim()),
 		)
 		if err != nil {
 			return err
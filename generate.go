@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/typeurl"
+	"github.com/crosbymichael/boss/config"
+	"github.com/urfave/cli"
+)
+
+var generateCommand = cli.Command{
+	Name:  "generate",
+	Usage: "generate configuration for boss-managed containers",
+	Subcommands: []cli.Command{
+		generateSystemdCommand,
+	},
+}
+
+var generateSystemdCommand = cli.Command{
+	Name:  "systemd",
+	Usage: "generate a systemd unit file for a container",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "restart-policy",
+			Value: "on-failure",
+			Usage: "systemd Restart= value",
+		},
+		cli.IntFlag{
+			Name:  "restart-sec",
+			Value: 1,
+			Usage: "seconds to wait between restarts",
+		},
+		cli.IntFlag{
+			Name:  "timeout",
+			Value: 30,
+			Usage: "TimeoutStartSec/TimeoutStopSec in seconds",
+		},
+		cli.BoolFlag{
+			Name:  "new",
+			Usage: "regenerate the container from its config on every start instead of attaching to the existing one",
+		},
+		cli.BoolFlag{
+			Name:  "files",
+			Usage: "write the unit directly under /etc/systemd/system instead of stdout",
+		},
+	},
+	Action: func(clix *cli.Context) error {
+		ctx := namespaces.WithNamespace(context.Background(), clix.GlobalString("namespace"))
+		client, err := containerd.New(
+			config.SocketAddress(),
+			containerd.WithDefaultRuntime(config.DefaultShim()),
+		)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		id := clix.Args().First()
+		if id == "" {
+			return fmt.Errorf("container id required")
+		}
+		container, err := client.LoadContainer(ctx, id)
+		if err != nil {
+			return err
+		}
+		info, err := container.Info(ctx)
+		if err != nil {
+			return err
+		}
+		v, err := typeurl.UnmarshalAny(info.Extensions[config.Extension])
+		if err != nil {
+			return err
+		}
+		c := v.(*config.Container)
+
+		unit := systemdUnit{
+			ID:            id,
+			Image:         c.Image,
+			RestartPolicy: clix.String("restart-policy"),
+			RestartSec:    clix.Int("restart-sec"),
+			Timeout:       clix.Int("timeout"),
+			New:           clix.Bool("new"),
+		}
+		out, err := unit.Render()
+		if err != nil {
+			return err
+		}
+		if !clix.Bool("files") {
+			_, err := fmt.Fprint(os.Stdout, out)
+			return err
+		}
+		path := filepath.Join("/etc/systemd/system", unit.UnitName())
+		return os.WriteFile(path, []byte(out), 0644)
+	},
+}
+
+type systemdUnit struct {
+	ID            string
+	Image         string
+	RestartPolicy string
+	RestartSec    int
+	Timeout       int
+	New           bool
+}
+
+func (u *systemdUnit) UnitName() string {
+	return fmt.Sprintf("boss-%s.service", u.ID)
+}
+
+func (u *systemdUnit) StartCommand() string {
+	if u.New {
+		return fmt.Sprintf("/usr/local/bin/boss create %s", u.ID)
+	}
+	return fmt.Sprintf("/usr/local/bin/boss start %s", u.ID)
+}
+
+func (u *systemdUnit) WaitCommand() string {
+	return fmt.Sprintf("/usr/local/bin/boss wait %s", u.ID)
+}
+
+// systemdUnitTemplate flips the container's status label (or creates it the
+// first time) in ExecStartPre, then blocks in ExecStart on `boss wait`,
+// which mirrors the task's own exit code. That gives systemd a process to
+// actually supervise, so Restart={{.RestartPolicy}} fires when the
+// container itself crashes rather than only when the boss daemon is down.
+var systemdUnitTemplate = template.Must(template.New("systemd").Parse(`[Unit]
+Description=boss container {{.ID}}
+After=network-online.target containerd.service
+Wants=network-online.target
+Requires=containerd.service
+
+[Service]
+ExecStartPre=-{{.StartCommand}}
+ExecStart={{.WaitCommand}}
+ExecStop=/usr/local/bin/boss delete {{.ID}}
+Restart={{.RestartPolicy}}
+RestartSec={{.RestartSec}}
+TimeoutStartSec={{.Timeout}}
+TimeoutStopSec={{.Timeout}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+func (u *systemdUnit) Render() (string, error) {
+	var buf bytes.Buffer
+	if err := systemdUnitTemplate.Execute(&buf, u); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
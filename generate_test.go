@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnitRenderSupervisesTheTask(t *testing.T) {
+	u := &systemdUnit{
+		ID:            "web",
+		RestartPolicy: "on-failure",
+		RestartSec:    1,
+		Timeout:       30,
+	}
+	out, err := u.Render()
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if !strings.Contains(out, "ExecStartPre=-/usr/local/bin/boss start web") {
+		t.Errorf("expected ExecStartPre to flip the status label, got:\n%s", out)
+	}
+	if !strings.Contains(out, "ExecStart=/usr/local/bin/boss wait web") {
+		t.Errorf("expected ExecStart to block on the task via `boss wait`, got:\n%s", out)
+	}
+	if strings.Contains(out, "Type=oneshot") || strings.Contains(out, "RemainAfterExit") {
+		t.Errorf("unit should not be oneshot/RemainAfterExit since ExecStart now blocks for the task's lifetime, got:\n%s", out)
+	}
+}
+
+func TestSystemdUnitRenderNew(t *testing.T) {
+	u := &systemdUnit{ID: "web", New: true}
+	out, err := u.Render()
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "ExecStartPre=-/usr/local/bin/boss create web") {
+		t.Errorf("expected the --new unit to create the container, got:\n%s", out)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/typeurl"
+	"github.com/crosbymichael/boss/config"
+	"github.com/crosbymichael/boss/monitor"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// noopRegister logs service state transitions without touching any backend;
+// used when running healthchecks for a single container outside the daemon
+type noopRegister struct{}
+
+func (noopRegister) Register(id, name, ip string, s config.Service) error { return nil }
+func (noopRegister) Deregister(id string) error                          { return nil }
+func (noopRegister) EnableMaintainance(id, msg string) error {
+	logrus.Warnf("%s: entering maintainance: %s", id, msg)
+	return nil
+}
+func (noopRegister) DisableMaintainance(id string) error {
+	logrus.Infof("%s: leaving maintainance", id)
+	return nil
+}
+
+var healthcheckCommand = cli.Command{
+	Name:  "healthcheck",
+	Usage: "manage service healthchecks for a container",
+	Subcommands: []cli.Command{
+		healthcheckRunCommand,
+		healthcheckStatusCommand,
+	},
+}
+
+var healthcheckRunCommand = cli.Command{
+	Name:  "run",
+	Usage: "run the configured healthchecks for a container in the foreground",
+	Action: func(clix *cli.Context) error {
+		ctx := namespaces.WithNamespace(context.Background(), clix.GlobalString("namespace"))
+		client, err := containerd.New(
+			config.SocketAddress(),
+			containerd.WithDefaultRuntime(config.DefaultShim()),
+		)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		id := clix.Args().First()
+		container, err := client.LoadContainer(ctx, id)
+		if err != nil {
+			return err
+		}
+		info, err := container.Info(ctx)
+		if err != nil {
+			return err
+		}
+		v, err := typeurl.UnmarshalAny(info.Extensions[config.Extension])
+		if err != nil {
+			return err
+		}
+		c := v.(*config.Container)
+
+		labels, err := container.Labels(ctx)
+		if err != nil {
+			return err
+		}
+		ip := labels[monitor.IPLabel]
+		if ip == "" {
+			return fmt.Errorf("container %s has no recorded ip, start it first", id)
+		}
+
+		m := monitor.New(client, noopRegister{}, nil)
+		if err := m.StartHealthchecks(ctx, container, c, ip); err != nil {
+			return err
+		}
+		logrus.Infof("running healthchecks for %s against %s", id, ip)
+		select {}
+	},
+}
+
+var healthcheckStatusCommand = cli.Command{
+	Name:  "status",
+	Usage: "show the current healthcheck state for a container",
+	Action: func(clix *cli.Context) error {
+		id := clix.Args().First()
+		h, err := monitor.Healthstatus(id)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(h)
+	},
+}
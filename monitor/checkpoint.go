@@ -0,0 +1,296 @@
+package monitor
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	runcoptions "github.com/containerd/containerd/runtime/v2/runc/options"
+	"github.com/containerd/typeurl"
+	"github.com/crosbymichael/boss/config"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// migrationExtensionHeader carries the base64'd io.boss/container extension
+// of the container being migrated
+const migrationExtensionHeader = "X-Boss-Extension"
+
+// CheckpointOptions control how a running task is checkpointed
+type CheckpointOptions struct {
+	// LeaveRunning keeps the task running after the checkpoint is taken
+	LeaveRunning bool
+	// TCPEstablished checkpoints established TCP connections
+	TCPEstablished bool
+	// Keep leaves the checkpoint image in the content store in addition to
+	// the exported tar
+	Keep bool
+	// Export writes the checkpoint tar to this path instead of the default
+	// <data root>/<id>/checkpoints/<name>.tar, where the data root is
+	// config.DataRoot() (/var/lib/boss unless running rootless)
+	Export string
+}
+
+// RestoreOptions control how a checkpoint is restored into a new task
+type RestoreOptions struct {
+	// LeaveRunning starts the restored task immediately
+	LeaveRunning bool
+	// TCPEstablished restores established TCP connections
+	TCPEstablished bool
+}
+
+// checkpointChange checkpoints a running container in place when its
+// StatusLabel is set to CheckpointStatus
+type checkpointChange struct {
+	container containerd.Container
+	m         *Monitor
+}
+
+func (c *checkpointChange) apply(ctx context.Context, client *containerd.Client) error {
+	if _, err := c.m.Checkpoint(ctx, c.container.ID(), CheckpointOptions{}); err != nil {
+		return err
+	}
+	// Checkpoint already killed the task. Leave the container stopped, the
+	// same way a stopChange would, so the next reconcile pass doesn't see a
+	// missing task against a "Running" label and start a brand-new one in
+	// place of the checkpoint that was just taken.
+	return c.container.Update(ctx, containerd.WithContainerLabels(map[string]string{
+		StatusLabel: string(containerd.Stopped),
+	}))
+}
+
+// checkpointDir returns the directory checkpoints for id are stored under
+func checkpointDir(id string) string {
+	return filepath.Join(config.DataRoot(), id, "checkpoints")
+}
+
+func withCheckpointTCPEstablished(i *containerd.CheckpointTaskInfo) error {
+	i.Options = &runcoptions.CheckpointOptions{TcpEstablished: true}
+	return nil
+}
+
+func withRestoreTCPEstablished(ctx context.Context, client *containerd.Client, ti *containerd.TaskInfo) error {
+	ti.Options = &runcoptions.CheckpointOptions{TcpEstablished: true}
+	return nil
+}
+
+// Checkpoint snapshots the running task for id to a tar archive, named after
+// the current time unless opts.Export is set
+func (m *Monitor) Checkpoint(ctx context.Context, id string, opts CheckpointOptions) (string, error) {
+	container, err := m.client.LoadContainer(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var taskOpts []containerd.CheckpointTaskOpts
+	if opts.TCPEstablished {
+		taskOpts = append(taskOpts, withCheckpointTCPEstablished)
+	}
+	image, err := task.Checkpoint(ctx, taskOpts...)
+	if err != nil {
+		return "", err
+	}
+
+	dest := opts.Export
+	if dest == "" {
+		if err := os.MkdirAll(checkpointDir(id), 0711); err != nil {
+			return "", err
+		}
+		dest = filepath.Join(checkpointDir(id), fmt.Sprintf("%d.tar", time.Now().UnixNano()))
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := m.client.Export(ctx, f, image.Target()); err != nil {
+		return "", err
+	}
+	if !opts.Keep {
+		if err := m.client.ImageService().Delete(ctx, image.Name()); err != nil {
+			logrus.WithError(err).Warnf("remove checkpoint image for %s", id)
+		}
+	}
+
+	if !opts.LeaveRunning {
+		if err := task.Kill(ctx, unix.SIGKILL); err != nil {
+			logrus.WithError(err).Warnf("kill task %s after checkpoint", id)
+		}
+	}
+	return dest, nil
+}
+
+// Restore creates a new task for id from a checkpoint tar previously written
+// by Checkpoint
+func (m *Monitor) Restore(ctx context.Context, id, checkpointPath string, opts RestoreOptions) error {
+	f, err := os.Open(checkpointPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	image, err := m.client.Import(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	container, err := m.client.LoadContainer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	taskOpts := []containerd.NewTaskOpts{containerd.WithTaskCheckpoint(image)}
+	if opts.TCPEstablished {
+		taskOpts = append(taskOpts, withRestoreTCPEstablished)
+	}
+	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStdio), taskOpts...)
+	if err != nil {
+		return err
+	}
+	if opts.LeaveRunning {
+		return task.Start(ctx)
+	}
+	return nil
+}
+
+// Migrate checkpoints id locally and streams the archive plus its boss
+// config extension to a peer boss daemon at addr, which restores it there.
+// The local container is left stopped once the transfer succeeds so this
+// host's own reconcile loop doesn't start a second, unrelated task in place
+// of the one that just moved.
+func (m *Monitor) Migrate(ctx context.Context, id, addr string) error {
+	if err := os.MkdirAll(checkpointDir(id), 0711); err != nil {
+		return err
+	}
+	path, err := m.Checkpoint(ctx, id, CheckpointOptions{Export: filepath.Join(checkpointDir(id), "migrate.tar")})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	container, err := m.client.LoadContainer(ctx, id)
+	if err != nil {
+		return err
+	}
+	info, err := container.Info(ctx)
+	if err != nil {
+		return err
+	}
+	if err := sendMigration(ctx, addr, id, path, info.Extensions[config.Extension].Value); err != nil {
+		return err
+	}
+	return container.Update(ctx, containerd.WithContainerLabels(map[string]string{
+		StatusLabel: string(containerd.Stopped),
+	}))
+}
+
+func sendMigration(ctx context.Context, addr, id, tarPath string, extension []byte) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/migrate/%s", addr, id), f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(migrationExtensionHeader, base64.StdEncoding.EncodeToString(extension))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("migrate %s to %s: status %s", id, addr, resp.Status)
+	}
+	return nil
+}
+
+// handleMigrate is the /migrate/<id> route Serve mounts ReceiveMigration on
+func (m *Monitor) handleMigrate(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/migrate/")
+	if id == "" {
+		http.Error(w, "container id required", http.StatusBadRequest)
+		return
+	}
+	m.ReceiveMigration(w, r, id)
+}
+
+// ReceiveMigration is the server side of Migrate: it accepts a streamed
+// checkpoint tar for id, recreates the container from the extension carried
+// in the request header, and restores the task from the checkpoint
+func (m *Monitor) ReceiveMigration(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	if err := os.MkdirAll(checkpointDir(id), 0711); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	path := filepath.Join(checkpointDir(id), "migrate.tar")
+	dst, err := os.Create(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := io.Copy(dst, r.Body); err != nil {
+		dst.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dst.Close()
+
+	extension, err := base64.StdEncoding.DecodeString(r.Header.Get(migrationExtensionHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v, err := typeurl.UnmarshalByTypeURL("io.boss.v1.Container", extension)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c := v.(*config.Container)
+
+	image, err := m.client.GetImage(ctx, c.Image)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	container, err := m.client.NewContainer(ctx, id, containerd.WithNewSnapshot(id, image), config.WithBossConfig(c, image))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := m.Restore(ctx, id, path, RestoreOptions{LeaveRunning: true}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ip, err := m.serviceIP(c, task)
+	if err != nil {
+		logrus.WithError(err).Errorf("resolve ip for migrated container %s", id)
+	}
+	for name, svc := range c.Services {
+		if err := m.register.Register(id, name, ip, svc); err != nil {
+			logrus.WithError(err).Errorf("register service %s for migrated container %s", name, id)
+		}
+	}
+}
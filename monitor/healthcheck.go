@@ -0,0 +1,434 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/typeurl"
+	"github.com/crosbymichael/boss/config"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// IPLabel records the ip address a container's services were registered
+	// with so a healthcheck can be reattached without re-running the network
+	// plugin
+	IPLabel = "io.boss/ip"
+
+	defaultRetries  = 3
+	maxCheckResults = 20
+	healthcheckFile = "healthcheck.json"
+)
+
+// CheckStatus is the current status of a single configured check
+type CheckStatus string
+
+const (
+	StatusStarting  CheckStatus = "starting"
+	StatusHealthy   CheckStatus = "healthy"
+	StatusUnhealthy CheckStatus = "unhealthy"
+)
+
+// CheckResult is the outcome of a single probe of a check
+type CheckResult struct {
+	Time     time.Time     `json:"time"`
+	Success  bool          `json:"success"`
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output"`
+}
+
+// CheckHealth is the rolling state for a single configured check
+type CheckHealth struct {
+	Type     config.CheckType `json:"type"`
+	Status   CheckStatus      `json:"status"`
+	Failures int              `json:"failures"`
+	Results  []CheckResult    `json:"results"`
+}
+
+// ServiceHealth is the persisted health state for every check of a service
+type ServiceHealth struct {
+	Service string         `json:"service"`
+	Checks  []*CheckHealth `json:"checks"`
+}
+
+// Health is the full persisted healthcheck state for a container, written to
+// <data root>/<id>/healthcheck.json, where the data root is config.DataRoot()
+// (/var/lib/boss unless running rootless)
+type Health struct {
+	ID       string                    `json:"id"`
+	Services map[string]*ServiceHealth `json:"services"`
+}
+
+// healthchecker runs the configured checks for a single container until
+// stopped
+type healthchecker struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+// StartHealthchecks launches a goroutine per configured check for every
+// service on the container and begins probing it at ip on the configured
+// interval
+func (m *Monitor) StartHealthchecks(ctx context.Context, c containerd.Container, config *config.Container, ip string) error {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+
+	if m.healthchecks == nil {
+		m.healthchecks = make(map[string]*healthchecker)
+	}
+	if h, ok := m.healthchecks[c.ID()]; ok {
+		h.cancel()
+	}
+
+	hctx, cancel := context.WithCancel(context.Background())
+	m.healthchecks[c.ID()] = &healthchecker{id: c.ID(), cancel: cancel}
+
+	if _, err := c.SetLabels(ctx, map[string]string{IPLabel: ip}); err != nil {
+		return err
+	}
+
+	for name, svc := range config.Services {
+		for i, check := range svc.Checks {
+			go m.runCheck(hctx, c.ID(), name, i, ip, svc.Port, check)
+		}
+	}
+	return nil
+}
+
+// syncHealthchecks starts checkers for containers that just came up with no
+// tracked checker yet and stops checkers for containers that aren't running
+// any more, so StartHealthchecks/StopHealthchecks are driven by the regular
+// reconcile loop instead of only by the standalone CLI
+func (m *Monitor) syncHealthchecks(ctx context.Context) error {
+	containers, err := m.client.Containers(ctx, fmt.Sprintf("labels.%q", StatusLabel))
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		task, err := c.Task(ctx, nil)
+		if err != nil {
+			continue
+		}
+		status, err := task.Status(ctx)
+		if err != nil || status.Status != containerd.Running {
+			continue
+		}
+		running[c.ID()] = true
+
+		m.healthMu.Lock()
+		_, tracked := m.healthchecks[c.ID()]
+		m.healthMu.Unlock()
+		if tracked {
+			continue
+		}
+
+		info, err := c.Info(ctx)
+		if err != nil {
+			logrus.WithError(err).Errorf("load info for %s", c.ID())
+			continue
+		}
+		v, err := typeurl.UnmarshalAny(info.Extensions[config.Extension])
+		if err != nil {
+			logrus.WithError(err).Errorf("load config for %s", c.ID())
+			continue
+		}
+		cfg := v.(*config.Container)
+		if len(cfg.Services) == 0 {
+			continue
+		}
+
+		ip, err := m.serviceIP(cfg, task)
+		if err != nil {
+			logrus.WithError(err).Errorf("resolve ip for %s", c.ID())
+			continue
+		}
+		if err := m.StartHealthchecks(ctx, c, cfg, ip); err != nil {
+			logrus.WithError(err).Errorf("start healthchecks for %s", c.ID())
+			continue
+		}
+		if fwd, ok := m.networks[cfg.EffectiveNetwork()].(PortForwarder); ok {
+			if err := fwd.Forward(c.ID(), cfg.Services); err != nil {
+				logrus.WithError(err).Errorf("forward ports for %s", c.ID())
+			}
+		}
+	}
+
+	m.healthMu.Lock()
+	for id := range m.healthchecks {
+		if !running[id] {
+			m.healthchecks[id].cancel()
+			delete(m.healthchecks, id)
+		}
+	}
+	m.healthMu.Unlock()
+	return nil
+}
+
+// serviceIP resolves the address a container's services are reachable at,
+// reusing the already-established network rather than creating a new one
+func (m *Monitor) serviceIP(cfg *config.Container, task containerd.Task) (string, error) {
+	netType := cfg.EffectiveNetwork()
+	if netType == config.Host {
+		return "127.0.0.1", nil
+	}
+	network, ok := m.networks[netType]
+	if !ok {
+		return "", fmt.Errorf("no network registered for type %q", netType)
+	}
+	return network.Create(task)
+}
+
+// StopHealthchecks stops all running checks for the container
+func (m *Monitor) StopHealthchecks(id string) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+
+	if h, ok := m.healthchecks[id]; ok {
+		h.cancel()
+		delete(m.healthchecks, id)
+	}
+}
+
+func (m *Monitor) runCheck(ctx context.Context, id, service string, index int, ip string, port int, check config.Check) {
+	interval := time.Duration(check.Interval) * time.Second
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	retries := check.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"id":      id,
+		"service": service,
+		"check":   check.Type,
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		result := probe(ip, port, check)
+		unhealthy, err := m.recordResult(id, service, index, check, result, retries)
+		if err != nil {
+			log.WithError(err).Error("record healthcheck result")
+			continue
+		}
+		if unhealthy {
+			log.Warn("service unhealthy, enabling maintainance")
+			if err := m.register.EnableMaintainance(id, fmt.Sprintf("%s: %s", service, result.Output)); err != nil {
+				log.WithError(err).Error("enable maintainance")
+			}
+			if err := m.restart(context.Background(), id); err != nil {
+				log.WithError(err).Error("restart unhealthy container")
+			}
+		} else if result.Success {
+			if err := m.register.DisableMaintainance(id); err != nil {
+				log.WithError(err).Error("disable maintainance")
+			}
+		}
+	}
+}
+
+// restart kills the task in place and flips the status label back to
+// Running so the reconcile loop starts a fresh one. The checkers for id are
+// stopped since they're probing an address that's about to go away;
+// syncHealthchecks restarts them against the new task's ip once it's back.
+func (m *Monitor) restart(ctx context.Context, id string) error {
+	m.StopHealthchecks(id)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	c, err := m.client.LoadContainer(ctx, id)
+	if err != nil {
+		return err
+	}
+	task, err := c.Task(ctx, nil)
+	if err == nil {
+		task.Kill(ctx, unix.SIGKILL)
+	}
+	return c.Update(ctx, containerd.WithContainerLabels(map[string]string{
+		StatusLabel: string(containerd.Running),
+	}))
+}
+
+// recordResult appends result to the persisted state for the check and
+// returns true if the check has just crossed into the unhealthy threshold
+func (m *Monitor) recordResult(id, service string, index int, check config.Check, result CheckResult, retries int) (bool, error) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+
+	health, err := loadHealth(id)
+	if err != nil {
+		return false, err
+	}
+	svc, ok := health.Services[service]
+	if !ok {
+		svc = &ServiceHealth{Service: service}
+		health.Services[service] = svc
+	}
+	for len(svc.Checks) <= index {
+		svc.Checks = append(svc.Checks, &CheckHealth{Status: StatusStarting})
+	}
+	ch := svc.Checks[index]
+	ch.Type = check.Type
+
+	ch.Results = append(ch.Results, result)
+	if len(ch.Results) > maxCheckResults {
+		ch.Results = ch.Results[len(ch.Results)-maxCheckResults:]
+	}
+
+	wasHealthy := ch.Status != StatusUnhealthy
+	if result.Success {
+		ch.Failures = 0
+		ch.Status = StatusHealthy
+	} else {
+		ch.Failures++
+		if ch.Failures >= retries {
+			ch.Status = StatusUnhealthy
+		}
+	}
+	becameUnhealthy := wasHealthy && ch.Status == StatusUnhealthy
+
+	return becameUnhealthy, saveHealth(id, health)
+}
+
+// Healthstatus returns the persisted healthcheck state for a container
+func Healthstatus(id string) (*Health, error) {
+	return loadHealth(id)
+}
+
+func healthPath(id string) string {
+	return filepath.Join(config.DataRoot(), id, healthcheckFile)
+}
+
+func loadHealth(id string) (*Health, error) {
+	path := healthPath(id)
+	h := &Health{
+		ID:       id,
+		Services: make(map[string]*ServiceHealth),
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func saveHealth(id string, h *Health) error {
+	if err := os.MkdirAll(filepath.Join(config.DataRoot(), id), 0711); err != nil {
+		return err
+	}
+	path := healthPath(id)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(h); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// probe runs a single check against ip:port and returns the result
+func probe(ip string, port int, check config.Check) CheckResult {
+	timeout := time.Duration(check.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	start := time.Now()
+	var err error
+	switch check.Type {
+	case config.HTTP:
+		err = probeHTTP(addr, timeout)
+	case config.TCP:
+		err = probeTCP(addr, timeout)
+	case config.GRPC:
+		err = probeGRPC(addr, timeout)
+	default:
+		err = fmt.Errorf("unknown check type %q", check.Type)
+	}
+	r := CheckResult{
+		Time:     start,
+		Success:  err == nil,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		r.Output = err.Error()
+	} else {
+		r.Output = "ok"
+	}
+	return r
+}
+
+func probeHTTP(addr string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(fmt.Sprintf("http://%s/", addr))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unhealthy status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func probeTCP(addr string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeGRPC(addr string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpc health status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"os"
+	"testing"
+
+	"github.com/crosbymichael/boss/config"
+)
+
+func TestRecordResultUnhealthyThreshold(t *testing.T) {
+	os.Setenv("XDG_DATA_HOME", t.TempDir())
+	defer os.Unsetenv("XDG_DATA_HOME")
+
+	m := &Monitor{}
+	id := "test-container"
+	check := config.Check{Type: config.TCP}
+
+	for i := 0; i < 2; i++ {
+		unhealthy, err := m.recordResult(id, "web", 0, check, CheckResult{Success: false}, 3)
+		if err != nil {
+			t.Fatalf("recordResult: %v", err)
+		}
+		if unhealthy {
+			t.Fatalf("expected healthy before reaching the retry threshold, got unhealthy at failure %d", i+1)
+		}
+	}
+
+	unhealthy, err := m.recordResult(id, "web", 0, check, CheckResult{Success: false}, 3)
+	if err != nil {
+		t.Fatalf("recordResult: %v", err)
+	}
+	if !unhealthy {
+		t.Fatal("expected the check to cross into unhealthy on the 3rd consecutive failure")
+	}
+
+	unhealthy, err = m.recordResult(id, "web", 0, check, CheckResult{Success: false}, 3)
+	if err != nil {
+		t.Fatalf("recordResult: %v", err)
+	}
+	if unhealthy {
+		t.Fatal("expected becameUnhealthy to only fire on the transition, not while already unhealthy")
+	}
+
+	unhealthy, err = m.recordResult(id, "web", 0, check, CheckResult{Success: true}, 3)
+	if err != nil {
+		t.Fatalf("recordResult: %v", err)
+	}
+	if unhealthy {
+		t.Fatal("a successful probe should never report unhealthy")
+	}
+
+	health, err := loadHealth(id)
+	if err != nil {
+		t.Fatalf("loadHealth: %v", err)
+	}
+	ch := health.Services["web"].Checks[0]
+	if ch.Status != StatusHealthy {
+		t.Fatalf("expected status %q after a successful probe, got %q", StatusHealthy, ch.Status)
+	}
+	if ch.Failures != 0 {
+		t.Fatalf("expected failures to reset to 0 after a successful probe, got %d", ch.Failures)
+	}
+}
@@ -17,8 +17,9 @@ import (
 
 const (
 	StatusLabel = "io.boss/restart.status"
-	// custom boss status
-	DeleteStatus containerd.ProcessStatus = "delete"
+	// custom boss statuses
+	DeleteStatus     containerd.ProcessStatus = "delete"
+	CheckpointStatus containerd.ProcessStatus = "checkpoint"
 )
 
 // Register is an object that registers and manages service information in its backend
@@ -34,6 +35,13 @@ type Network interface {
 	Remove(containerd.Container) error
 }
 
+// PortForwarder is an optional interface a Network can implement to receive
+// a container's service ports once it's running, for userspace networks
+// like slirp4netns that forward host ports after the guest is up
+type PortForwarder interface {
+	Forward(id string, services map[string]config.Service) error
+}
+
 // New returns a new monitor for containers
 func New(client *containerd.Client, register Register, networks map[config.NetworkType]Network) *Monitor {
 	return &Monitor{
@@ -50,6 +58,9 @@ type Monitor struct {
 	networks   map[config.NetworkType]Network
 	shutdownCh chan struct{}
 	mu         sync.Mutex
+
+	healthMu     sync.Mutex
+	healthchecks map[string]*healthchecker
 }
 
 func (m *Monitor) Stop() {
@@ -191,6 +202,9 @@ func (m *Monitor) reconcile(ctx context.Context) error {
 				logrus.WithError(err).Error("apply change")
 			}
 		}
+		if err := m.syncHealthchecks(ctx); err != nil {
+			logrus.WithError(err).Error("sync healthchecks")
+		}
 	}
 	return nil
 }
@@ -227,6 +241,11 @@ func (m *Monitor) monitor(ctx context.Context) ([]change, error) {
 				container: c,
 				m:         m,
 			})
+		case CheckpointStatus:
+			changes = append(changes, &checkpointChange{
+				container: c,
+				m:         m,
+			})
 		}
 	}
 	return changes, nil
@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/crosbymichael/boss/config"
+)
+
+// slirp4netnsGuestAddress is the address slirp4netns assigns inside the
+// container's network namespace when run with --configure
+const slirp4netnsGuestAddress = "10.0.2.100"
+
+// slirp4netnsStartupTimeout bounds how long Create waits for the api-socket
+// to appear before giving up on a slirp4netns process that never came up
+const slirp4netnsStartupTimeout = 5 * time.Second
+
+// Slirp4netns is the userspace Network rootless containers use in place of
+// CNI: it gives the container outbound connectivity without the privileged
+// syscalls CNI's bridge/iptables setup needs, and forwards host ports in
+// instead of a privileged iptables DNAT rule.
+type Slirp4netns struct {
+	mu      sync.Mutex
+	sockets map[string]string // container id -> slirp4netns api socket path
+}
+
+// Create starts a slirp4netns process attached to task's network namespace
+// and returns the address the container is reachable at
+func (s *Slirp4netns) Create(task containerd.Task) (string, error) {
+	id := task.ID()
+	sock := apiSocketPath(id)
+
+	cmd := exec.Command("slirp4netns",
+		"--configure",
+		"--mtu=65520",
+		"--disable-host-loopback",
+		"--api-socket", sock,
+		strconv.Itoa(int(task.Pid())),
+		"tap0",
+	)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	go cmd.Wait()
+
+	if err := waitForSocket(sock, slirp4netnsStartupTimeout); err != nil {
+		return "", fmt.Errorf("wait for slirp4netns api socket: %w", err)
+	}
+
+	s.mu.Lock()
+	if s.sockets == nil {
+		s.sockets = make(map[string]string)
+	}
+	s.sockets[id] = sock
+	s.mu.Unlock()
+
+	return slirp4netnsGuestAddress, nil
+}
+
+// Remove stops tracking the container's slirp4netns process; the process
+// itself exits on its own once the network namespace it joined goes away
+func (s *Slirp4netns) Remove(c containerd.Container) error {
+	s.mu.Lock()
+	delete(s.sockets, c.ID())
+	s.mu.Unlock()
+	return nil
+}
+
+// Forward adds a host port forward for every service port so services
+// exposed by a rootless container are reachable the same way a CNI/iptables
+// DNAT rule would make them for a privileged one
+func (s *Slirp4netns) Forward(id string, services map[string]config.Service) error {
+	s.mu.Lock()
+	sock, ok := s.sockets[id]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no slirp4netns api socket tracked for %s", id)
+	}
+
+	for name, svc := range services {
+		if svc.Port == 0 {
+			continue
+		}
+		if err := addHostForward(sock, svc.Port); err != nil {
+			return fmt.Errorf("forward port for service %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func apiSocketPath(id string) string {
+	return filepath.Join(config.DataRoot(), id, "slirp4netns.sock")
+}
+
+// waitForSocket polls for path to appear, so callers don't race a
+// slirp4netns process that's still starting up
+func waitForSocket(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// addHostForward asks a running slirp4netns process, over its api-socket, to
+// forward host port to the same port on the guest
+func addHostForward(sock string, port int) error {
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := map[string]interface{}{
+		"execute": "add_hostfwd",
+		"arguments": map[string]interface{}{
+			"proto":      "tcp",
+			"host_addr":  "0.0.0.0",
+			"host_port":  port,
+			"guest_addr": slirp4netnsGuestAddress,
+			"guest_port": port,
+		},
+	}
+	enc, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(enc)
+	return err
+}
@@ -0,0 +1,288 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/containerd/cgroups/stats/v1"
+	v2 "github.com/containerd/cgroups/v2/stats"
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/typeurl"
+	"github.com/sirupsen/logrus"
+)
+
+// statsInterval is how often a streamed Stats channel polls task.Metrics
+const statsInterval = 5 * time.Second
+
+// Stats is a point-in-time snapshot of a container's resource usage, decoded
+// from containerd's cgroup metrics
+type Stats struct {
+	Timestamp time.Time           `json:"timestamp"`
+	ID        string              `json:"id"`
+	CPU       CPUStats            `json:"cpu"`
+	Memory    MemoryStats         `json:"memory"`
+	Pids      PidsStats           `json:"pids"`
+	Network   map[string]NetStats `json:"network"`
+}
+
+type CPUStats struct {
+	UsageNanos uint64 `json:"usage_ns"`
+}
+
+type MemoryStats struct {
+	Usage uint64 `json:"usage"`
+	Cache uint64 `json:"cache"`
+	Limit uint64 `json:"limit"`
+}
+
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit"`
+}
+
+type NetStats struct {
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+// Stats subscribes to containerd's task metrics for id, polling every
+// statsInterval, until ctx is canceled
+func (m *Monitor) Stats(ctx context.Context, id string) (<-chan Stats, error) {
+	container, err := m.client.LoadContainer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Stats, 1)
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(statsInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s, err := collectStats(ctx, id, task)
+				if err != nil {
+					logrus.WithError(err).Errorf("collect stats for %s", id)
+					continue
+				}
+				select {
+				case ch <- s:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func collectStats(ctx context.Context, id string, task containerd.Task) (Stats, error) {
+	metric, err := task.Metrics(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	v, err := typeurl.UnmarshalAny(metric.Data)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	s := Stats{Timestamp: time.Now(), ID: id, Network: make(map[string]NetStats)}
+	switch data := v.(type) {
+	case *v1.Metrics:
+		collectCgroupV1(&s, data)
+	case *v2.Metrics:
+		collectCgroupV2(&s, data)
+	default:
+		return Stats{}, fmt.Errorf("unsupported metrics type %T", v)
+	}
+	return s, nil
+}
+
+// collectCgroupV1 fills s from a cgroup v1 host's metrics
+func collectCgroupV1(s *Stats, data *v1.Metrics) {
+	if data.CPU != nil && data.CPU.Usage != nil {
+		s.CPU.UsageNanos = data.CPU.Usage.Total
+	}
+	if data.Memory != nil && data.Memory.Usage != nil {
+		s.Memory.Usage = data.Memory.Usage.Usage
+		s.Memory.Limit = data.Memory.Usage.Limit
+		s.Memory.Cache = data.Memory.Cache
+	}
+	if data.Pids != nil {
+		s.Pids.Current = data.Pids.Current
+		s.Pids.Limit = data.Pids.Limit
+	}
+	for _, n := range data.Network {
+		s.Network[n.Name] = NetStats{RxBytes: n.RxBytes, TxBytes: n.TxBytes}
+	}
+}
+
+// collectCgroupV2 fills s from a cgroup v2 host's metrics. Network isn't
+// cgroup-scoped under v2, so Network is left empty here same as it would be
+// for a container with no interfaces under v1.
+func collectCgroupV2(s *Stats, data *v2.Metrics) {
+	if data.CPU != nil {
+		s.CPU.UsageNanos = data.CPU.UsageUsec * uint64(time.Microsecond)
+	}
+	if data.Memory != nil {
+		s.Memory.Usage = data.Memory.Usage
+		s.Memory.Limit = data.Memory.UsageLimit
+		s.Memory.Cache = data.Memory.File
+	}
+	if data.Pids != nil {
+		s.Pids.Current = data.Pids.Current
+		s.Pids.Limit = data.Pids.Limit
+	}
+}
+
+// Serve starts an HTTP server exposing Prometheus metrics at /metrics and
+// per-container stats at /stats/<id>
+func (m *Monitor) Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.handleMetrics)
+	mux.HandleFunc("/stats/", m.handleStats)
+	mux.HandleFunc("/migrate/", m.handleMigrate)
+	return http.ListenAndServe(addr, mux)
+}
+
+// handleMetrics renders every monitored container's stats and healthcheck
+// state in Prometheus text format. It holds the same mutex the reconcile
+// loop does so a scrape can't race with shutdown tearing containers down.
+func (m *Monitor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx := r.Context()
+	ns, err := m.client.NamespaceService().List(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, name := range ns {
+		nsCtx := namespaces.WithNamespace(ctx, name)
+		containers, err := m.client.Containers(nsCtx, fmt.Sprintf("labels.%q", StatusLabel))
+		if err != nil {
+			logrus.WithError(err).Errorf("list containers in %s", name)
+			continue
+		}
+		for _, c := range containers {
+			m.writeContainerMetrics(&buf, nsCtx, name, c)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+func (m *Monitor) writeContainerMetrics(buf *bytes.Buffer, ctx context.Context, namespace string, c containerd.Container) {
+	task, err := c.Task(ctx, nil)
+	if err != nil {
+		return
+	}
+	stats, err := collectStats(ctx, c.ID(), task)
+	if err == nil {
+		labels := fmt.Sprintf("namespace=%q,container=%q", namespace, c.ID())
+		fmt.Fprintf(buf, "boss_cpu_usage_nanoseconds{%s} %d\n", labels, stats.CPU.UsageNanos)
+		fmt.Fprintf(buf, "boss_memory_usage_bytes{%s} %d\n", labels, stats.Memory.Usage)
+		fmt.Fprintf(buf, "boss_memory_cache_bytes{%s} %d\n", labels, stats.Memory.Cache)
+		fmt.Fprintf(buf, "boss_memory_limit_bytes{%s} %d\n", labels, stats.Memory.Limit)
+		fmt.Fprintf(buf, "boss_pids_current{%s} %d\n", labels, stats.Pids.Current)
+		fmt.Fprintf(buf, "boss_pids_limit{%s} %d\n", labels, stats.Pids.Limit)
+		for iface, n := range stats.Network {
+			fmt.Fprintf(buf, "boss_network_rx_bytes{%s,interface=%q} %d\n", labels, iface, n.RxBytes)
+			fmt.Fprintf(buf, "boss_network_tx_bytes{%s,interface=%q} %d\n", labels, iface, n.TxBytes)
+		}
+	}
+
+	health, err := loadHealth(c.ID())
+	if err != nil {
+		return
+	}
+	for service, sh := range health.Services {
+		for _, ch := range sh.Checks {
+			value := 0
+			if ch.Status == StatusHealthy {
+				value = 1
+			}
+			fmt.Fprintf(buf, "boss_healthcheck_status{namespace=%q,container=%q,service=%q,check_type=%q} %d\n",
+				namespace, c.ID(), service, ch.Type, value)
+		}
+	}
+}
+
+// handleStats serves a single snapshot of /stats/<id>, or with
+// ?stream=true a newline-delimited JSON feed of snapshots until the client
+// disconnects
+func (m *Monitor) handleStats(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/stats/")
+	if id == "" {
+		http.Error(w, "container id required", http.StatusBadRequest)
+		return
+	}
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		namespace = "default"
+	}
+	ctx := namespaces.WithNamespace(r.Context(), namespace)
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+
+	if r.URL.Query().Get("stream") != "true" {
+		container, err := m.client.LoadContainer(ctx, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		task, err := container.Task(ctx, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		s, err := collectStats(ctx, id, task)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		enc.Encode(s)
+		return
+	}
+
+	ch, err := m.Stats(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case s, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(s); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/crosbymichael/boss/config"
+	"github.com/urfave/cli"
+)
+
+// waitCommand blocks until a container's task exits and mirrors its exit
+// code, so a process supervisor (e.g. the systemd units boss generate
+// systemd emits) can tell a crashed container apart from one boss itself
+// stopped or deleted
+var waitCommand = cli.Command{
+	Name:  "wait",
+	Usage: "block until a container's task exits, mirroring its exit code",
+	Action: func(clix *cli.Context) error {
+		ctx := namespaces.WithNamespace(context.Background(), clix.GlobalString("namespace"))
+		client, err := containerd.New(
+			config.SocketAddress(),
+			containerd.WithDefaultRuntime(config.DefaultShim()),
+		)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		id := clix.Args().First()
+		container, err := client.LoadContainer(ctx, id)
+		if err != nil {
+			return err
+		}
+		task, err := container.Task(ctx, nil)
+		if err != nil {
+			return err
+		}
+		statusC, err := task.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		status := <-statusC
+		os.Exit(int(status.ExitCode()))
+		return nil
+	},
+}